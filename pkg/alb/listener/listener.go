@@ -0,0 +1,278 @@
+// Package listener reconciles a single ALB/NLB listener: its port,
+// protocol, default certificate and (ALB only) attached SNI certificates.
+// Rule reconciliation lives in the sibling rules package; a Listener just
+// carries a Rules value through to it.
+package listener
+
+import (
+	"strings"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/elbv2"
+	ruleP "github.com/coreos/alb-ingress-controller/pkg/alb/rule"
+	"github.com/coreos/alb-ingress-controller/pkg/alb/rules"
+	"github.com/coreos/alb-ingress-controller/pkg/alb/targetgroups"
+	"github.com/coreos/alb-ingress-controller/pkg/annotations"
+	albelbv2 "github.com/coreos/alb-ingress-controller/pkg/aws/elbv2"
+	"github.com/coreos/alb-ingress-controller/pkg/util/log"
+	extensions "k8s.io/api/extensions/v1beta1"
+)
+
+// Listener represents the current and desired state of a single listener,
+// along with the rules attached to it.
+type Listener struct {
+	CurrentListener *elbv2.Listener
+	DesiredListener *elbv2.Listener
+	Rules           rules.Rules
+	Deleted         bool
+
+	// DesiredSNICertificateArns is the full set of SNI certificates the
+	// listener should carry once reconciled; CurrentSNICertificateArns is
+	// the set it actually carries now, hydrated from DescribeListenerCertificates.
+	// Reconcile diffs the two and issues Add/RemoveListenerCertificates for
+	// the difference rather than recreating the listener.
+	DesiredSNICertificateArns []*string
+	CurrentSNICertificateArns []*string
+
+	logger *log.Logger
+}
+
+// NewListenerOptions configures NewListener.
+type NewListenerOptions struct {
+	Port               annotations.PortData
+	CertificateArn     *string
+	SNICertificateArns []*string
+	IsNLB              bool
+	// DefaultBackend resolves the single target group an NLB listener
+	// forwards to; ALB listeners forward via per-path rules instead and
+	// leave this nil.
+	DefaultBackend *extensions.IngressBackend
+	TargetGroups   targetgroups.TargetGroups
+	Logger         *log.Logger
+}
+
+// NewListener builds the Listener a reconcile pass wants a port to end up
+// as.
+func NewListener(o *NewListenerOptions) *Listener {
+	protocol := protocolFor(o.Port.Scheme, o.IsNLB, o.CertificateArn != nil)
+
+	// Plain HTTP/TCP listeners carry no certificates.
+	certificateArn, sniCertificateArns := o.CertificateArn, o.SNICertificateArns
+	if protocol == elbv2.ProtocolEnumHttp || protocol == elbv2.ProtocolEnumTcp {
+		certificateArn, sniCertificateArns = nil, nil
+	}
+
+	desired := &elbv2.Listener{
+		Port:         aws.Int64(o.Port.Port),
+		Protocol:     aws.String(protocol),
+		Certificates: defaultCertificates(certificateArn),
+	}
+
+	if o.IsNLB && o.DefaultBackend != nil {
+		var tgArn *string
+		if o.TargetGroups != nil {
+			tgArn = o.TargetGroups.Arn(o.DefaultBackend.ServiceName, int32(o.DefaultBackend.ServicePort.IntValue()))
+		}
+		desired.DefaultActions = []*elbv2.Action{ruleP.NewForwardAction(tgArn)}
+	}
+
+	return &Listener{
+		DesiredListener:           desired,
+		DesiredSNICertificateArns: sniCertificateArns,
+		logger:                    o.Logger,
+	}
+}
+
+// NewListenerFromAWSListener wraps an elbv2.Listener already attached to the
+// load balancer, hydrating its current SNI certificate set so Reconcile can
+// diff it against whatever the next NewListener call wants.
+func NewListenerFromAWSListener(awsListener *elbv2.Listener, logger *log.Logger) *Listener {
+	l := &Listener{CurrentListener: awsListener, logger: logger}
+
+	arns, err := albelbv2.ELBV2svc.DescribeListenerCertificatesForListener(awsListener.ListenerArn)
+	if err != nil {
+		logger.Errorf("failed describing listener certificates for %s: %v", aws.StringValue(awsListener.ListenerArn), err)
+	} else {
+		l.CurrentSNICertificateArns = arns
+	}
+
+	return l
+}
+
+// SupportsRules reports whether this listener can have path/host rules
+// attached to it. NLB listeners (TCP/TLS) forward directly to a single
+// target group and never support rules; ALB listeners (HTTP/HTTPS) always do.
+func (l *Listener) SupportsRules() bool {
+	protocol := ""
+	if l.CurrentListener != nil {
+		protocol = aws.StringValue(l.CurrentListener.Protocol)
+	} else if l.DesiredListener != nil {
+		protocol = aws.StringValue(l.DesiredListener.Protocol)
+	}
+	return protocol == elbv2.ProtocolEnumHttp || protocol == elbv2.ProtocolEnumHttps
+}
+
+// NeedsModification reports whether the listener's port, protocol or
+// default certificate differ from target. The SNI certificate set is
+// reconciled separately, via Add/RemoveListenerCertificates, since unlike
+// these fields it isn't part of ModifyListener's input.
+func (l *Listener) NeedsModification(target *elbv2.Listener) bool {
+	if l.CurrentListener == nil {
+		return true
+	}
+	current := l.CurrentListener
+	if aws.Int64Value(current.Port) != aws.Int64Value(target.Port) {
+		return true
+	}
+	if aws.StringValue(current.Protocol) != aws.StringValue(target.Protocol) {
+		return true
+	}
+	return !certificatesEqual(current.Certificates, target.Certificates)
+}
+
+// ReconcileOptions carries the inputs Listener.Reconcile needs beyond the
+// listener's own Current/DesiredListener fields.
+type ReconcileOptions struct {
+	Eventf          func(string, string, string, ...interface{})
+	LoadBalancerArn *string
+	TargetGroups    targetgroups.TargetGroups
+}
+
+func NewReconcileOptions() *ReconcileOptions {
+	return &ReconcileOptions{}
+}
+
+func (r *ReconcileOptions) SetEventf(f func(string, string, string, ...interface{})) *ReconcileOptions {
+	r.Eventf = f
+	return r
+}
+
+func (r *ReconcileOptions) SetLoadBalancerArn(arn *string) *ReconcileOptions {
+	r.LoadBalancerArn = arn
+	return r
+}
+
+func (r *ReconcileOptions) SetTargetGroups(tgs targetgroups.TargetGroups) *ReconcileOptions {
+	r.TargetGroups = tgs
+	return r
+}
+
+// Reconcile creates, modifies or deletes the listener against ALB, then
+// reconciles its SNI certificate set against DesiredSNICertificateArns.
+func (l *Listener) Reconcile(rOpts *ReconcileOptions) error {
+	switch {
+	case l.DesiredListener == nil && l.CurrentListener != nil:
+		if err := albelbv2.ELBV2svc.DeleteListener(l.CurrentListener.ListenerArn); err != nil {
+			return err
+		}
+		l.Deleted = true
+		return nil
+
+	case l.CurrentListener == nil && l.DesiredListener != nil:
+		created, err := albelbv2.ELBV2svc.CreateListener(&elbv2.CreateListenerInput{
+			LoadBalancerArn: rOpts.LoadBalancerArn,
+			Port:            l.DesiredListener.Port,
+			Protocol:        l.DesiredListener.Protocol,
+			Certificates:    l.DesiredListener.Certificates,
+			DefaultActions:  l.DesiredListener.DefaultActions,
+		})
+		if err != nil {
+			return err
+		}
+		l.CurrentListener = created
+
+	case l.NeedsModification(l.DesiredListener):
+		modified, err := albelbv2.ELBV2svc.ModifyListener(&elbv2.ModifyListenerInput{
+			ListenerArn:    l.CurrentListener.ListenerArn,
+			Port:           l.DesiredListener.Port,
+			Protocol:       l.DesiredListener.Protocol,
+			Certificates:   l.DesiredListener.Certificates,
+			DefaultActions: l.DesiredListener.DefaultActions,
+		})
+		if err != nil {
+			return err
+		}
+		l.CurrentListener = modified
+	}
+
+	return l.reconcileSNICertificates()
+}
+
+// reconcileSNICertificates adds any certificate in DesiredSNICertificateArns
+// missing from CurrentSNICertificateArns, and removes any certificate in
+// CurrentSNICertificateArns no longer desired.
+func (l *Listener) reconcileSNICertificates() error {
+	if l.CurrentListener == nil {
+		return nil
+	}
+
+	var toAdd, toRemove []*string
+	for _, arn := range l.DesiredSNICertificateArns {
+		if !containsArn(l.CurrentSNICertificateArns, arn) {
+			toAdd = append(toAdd, arn)
+		}
+	}
+	for _, arn := range l.CurrentSNICertificateArns {
+		if !containsArn(l.DesiredSNICertificateArns, arn) {
+			toRemove = append(toRemove, arn)
+		}
+	}
+
+	if len(toAdd) == 0 && len(toRemove) == 0 {
+		return nil
+	}
+
+	if err := albelbv2.ELBV2svc.AddListenerCertificates(l.CurrentListener.ListenerArn, toAdd); err != nil {
+		return err
+	}
+	if err := albelbv2.ELBV2svc.RemoveListenerCertificates(l.CurrentListener.ListenerArn, toRemove); err != nil {
+		return err
+	}
+
+	l.CurrentSNICertificateArns = l.DesiredSNICertificateArns
+	return nil
+}
+
+func protocolFor(scheme string, isNLB, hasCertificate bool) string {
+	if isNLB {
+		if hasCertificate {
+			return elbv2.ProtocolEnumTls
+		}
+		return elbv2.ProtocolEnumTcp
+	}
+	if hasCertificate && strings.EqualFold(scheme, elbv2.ProtocolEnumHttps) {
+		return elbv2.ProtocolEnumHttps
+	}
+	return elbv2.ProtocolEnumHttp
+}
+
+func defaultCertificates(certificateArn *string) []*elbv2.Certificate {
+	if certificateArn == nil {
+		return nil
+	}
+	return []*elbv2.Certificate{{CertificateArn: certificateArn}}
+}
+
+func certificatesEqual(a, b []*elbv2.Certificate) bool {
+	aArn, bArn := certArn(a), certArn(b)
+	return aArn == bArn
+}
+
+func certArn(certs []*elbv2.Certificate) string {
+	if len(certs) == 0 {
+		return ""
+	}
+	return aws.StringValue(certs[0].CertificateArn)
+}
+
+func containsArn(arns []*string, arn *string) bool {
+	if arn == nil {
+		return false
+	}
+	for _, a := range arns {
+		if a != nil && *a == *arn {
+			return true
+		}
+	}
+	return false
+}
@@ -1,12 +1,18 @@
 package listeners
 
 import (
+	"fmt"
+	"strconv"
+	"sync"
+
 	"github.com/aws/aws-sdk-go/service/elbv2"
 	listenerP "github.com/coreos/alb-ingress-controller/pkg/alb/listener"
 	ruleP "github.com/coreos/alb-ingress-controller/pkg/alb/rule"
 	rulesP "github.com/coreos/alb-ingress-controller/pkg/alb/rules"
+	"github.com/coreos/alb-ingress-controller/pkg/alb/status"
 	"github.com/coreos/alb-ingress-controller/pkg/alb/targetgroups"
 	"github.com/coreos/alb-ingress-controller/pkg/annotations"
+	albacm "github.com/coreos/alb-ingress-controller/pkg/aws/acm"
 	albelbv2 "github.com/coreos/alb-ingress-controller/pkg/aws/elbv2"
 	"github.com/coreos/alb-ingress-controller/pkg/util/log"
 	extensions "k8s.io/api/extensions/v1beta1"
@@ -33,6 +39,7 @@ func (ls Listeners) Reconcile(rOpts *ReconcileOptions) (Listeners, error) {
 		return nil, nil
 	}
 
+	allDeleted := true
 	for _, listener := range ls {
 		lOpts := listenerP.NewReconcileOptions()
 		lOpts.SetEventf(rOpts.Eventf)
@@ -41,21 +48,53 @@ func (ls Listeners) Reconcile(rOpts *ReconcileOptions) (Listeners, error) {
 		if err := listener.Reconcile(lOpts); err != nil {
 			return nil, err
 		}
+		if !listener.Deleted {
+			allDeleted = false
+		}
 
-		rulesOpts := rulesP.NewReconcileOptions()
-		rulesOpts.SetEventf(rOpts.Eventf)
-		rulesOpts.SetListenerArn(listener.CurrentListener.ListenerArn)
-		rulesOpts.SetTargetGroups(rOpts.TargetGroups)
-		if rules, err := listener.Rules.Reconcile(rulesOpts); err != nil {
-			return nil, err
-		} else {
+		// NLB listeners forward directly to a target group and don't support
+		// rules at all, so skip rule reconciliation entirely for them.
+		if listener.SupportsRules() {
+			rulesOpts := rulesP.NewReconcileOptions()
+			rulesOpts.SetEventf(rOpts.Eventf)
+			rulesOpts.SetListenerArn(listener.CurrentListener.ListenerArn)
+			rulesOpts.SetTargetGroups(rOpts.TargetGroups)
+			rules, changed, err := listener.Rules.Reconcile(rulesOpts)
+			if err != nil {
+				// Rules reconciled before the failure may already have been
+				// mutated, so the cached snapshot can't be trusted either.
+				albelbv2.ELBV2svc.CacheDelete(albelbv2.DescribeRulesCache, *listener.CurrentListener.ListenerArn)
+				return nil, err
+			}
 			listener.Rules = rules
+			if changed {
+				// A rule was actually created, modified or deleted under this
+				// listener; drop it from the DescribeRules cache so the next
+				// sync re-fetches instead of reconciling against a stale
+				// snapshot. Reconciling pass after pass with nothing to change
+				// leaves the cache entry alone, which is the point of caching
+				// it in the first place.
+				albelbv2.ELBV2svc.CacheDelete(albelbv2.DescribeRulesCache, *listener.CurrentListener.ListenerArn)
+			}
 		}
 		if !listener.Deleted {
 			output = append(output, listener)
 		}
 	}
 
+	if rOpts.StatusWriter != nil {
+		// output is only ever appended to, so len(output) == 0 can't detect
+		// "every listener was deleted this pass" once ls was non-empty;
+		// track deletions explicitly instead.
+		if allDeleted || rOpts.LoadBalancerArn == nil {
+			rOpts.StatusWriter.Clear(rOpts.IngressNamespace, rOpts.IngressName)
+		} else if dnsName, err := albelbv2.ELBV2svc.DescribeLoadBalancerDNSName(rOpts.LoadBalancerArn); err != nil {
+			return nil, err
+		} else {
+			rOpts.StatusWriter.Schedule(rOpts.IngressNamespace, rOpts.IngressName, dnsName, rOpts.IngressCNAME)
+		}
+	}
+
 	return output, nil
 }
 
@@ -79,47 +118,96 @@ func (ls Listeners) StripCurrentState() {
 	}
 }
 
+// describeRulesWorkers bounds how many DescribeRules calls NewListenersFromAWSListeners
+// issues concurrently, so large ingresses resolve in O(N/describeRulesWorkers) round-trips
+// instead of one serial DescribeRules per listener.
+const describeRulesWorkers = 8
+
 // NewListenersFromAWSListeners returns a new listeners.Listeners based on an elbv2.Listeners.
 func NewListenersFromAWSListeners(listeners []*elbv2.Listener, logger *log.Logger) (Listeners, error) {
-	var output Listeners
+	output := make(Listeners, len(listeners))
+	errs := make([]error, len(listeners))
+
+	work := make(chan int)
+	var wg sync.WaitGroup
+	for w := 0; w < describeRulesWorkers; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range work {
+				output[i], errs[i] = newListenerFromAWSListener(listeners[i], logger)
+			}
+		}()
+	}
+	for i := range listeners {
+		work <- i
+	}
+	close(work)
+	wg.Wait()
 
-	for _, listener := range listeners {
-		logger.Infof("Fetching Rules for Listener %s", *listener.ListenerArn)
-		rules, err := albelbv2.ELBV2svc.DescribeRules(&elbv2.DescribeRulesInput{ListenerArn: listener.ListenerArn})
+	for _, err := range errs {
 		if err != nil {
 			return nil, err
 		}
+	}
+	return output, nil
+}
 
-		l := listenerP.NewListenerFromAWSListener(listener, logger)
+func newListenerFromAWSListener(listener *elbv2.Listener, logger *log.Logger) (*listenerP.Listener, error) {
+	logger.Infof("Fetching Rules for Listener %s", *listener.ListenerArn)
+	// DescribeRulesCached is backed by a TTL cache keyed by ListenerArn
+	// (mirroring the DescribeTargetGroupTargetsForArnCache pattern), so a
+	// listener whose rules haven't changed since the last sync avoids a
+	// DescribeRules round-trip entirely. Listeners.Reconcile calls
+	// albelbv2.ELBV2svc.CacheDelete(DescribeRulesCache, ...) whenever
+	// listener.Rules.Reconcile mutates a rule (or fails partway), so the
+	// controller's own rule changes are never served from a stale snapshot.
+	rules, err := albelbv2.ELBV2svc.DescribeRulesCached(&elbv2.DescribeRulesInput{ListenerArn: listener.ListenerArn})
+	if err != nil {
+		return nil, err
+	}
 
-		for _, rule := range rules.Rules {
-			logger.Debugf("Assembling rule for: %s", log.Prettify(rule.Conditions))
-			r := ruleP.NewRuleFromAWSRule(rule, logger)
+	l := listenerP.NewListenerFromAWSListener(listener, logger)
 
-			l.Rules = append(l.Rules, r)
-		}
+	for _, rule := range rules.Rules {
+		// rule.Conditions may now carry any of host-header, path-pattern,
+		// http-header, http-request-method, query-string or source-ip
+		// fields (possibly several of each); NewRuleFromAWSRule hydrates
+		// all of them so reconciliation against the Ingress-derived
+		// rules stays idempotent.
+		logger.Debugf("Assembling rule for: %s", log.Prettify(rule.Conditions))
+		r := ruleP.NewRuleFromAWSRule(rule, logger)
 
-		output = append(output, l)
+		l.Rules = append(l.Rules, r)
 	}
-	return output, nil
+
+	return l, nil
 }
 
 type NewListenersFromIngressOptions struct {
-	Ingress     *extensions.Ingress
-	Listeners   Listeners
-	Annotations *annotations.Annotations
-	Logger      *log.Logger
-	Priority    int
+	Ingress      *extensions.Ingress
+	Listeners    Listeners
+	Annotations  *annotations.Annotations
+	TargetGroups targetgroups.TargetGroups
+	Logger       *log.Logger
+	Priority     int
+	// PriorityAllocator assigns stable rule priorities when multiple
+	// Ingresses are merged onto the same listener. Callers reconciling a
+	// whole ALB share a single allocator across every Ingress so priorities
+	// don't collide; if nil, a fresh one scoped to this call is used.
+	PriorityAllocator *PriorityAllocator
 }
 
 func NewListenersFromIngress(o *NewListenersFromIngressOptions) (Listeners, error) {
 	var output Listeners
 
+	allocator := o.PriorityAllocator
+	if allocator == nil {
+		allocator = NewPriorityAllocator()
+	}
+
 	// Generate a listener for each port in the annotations
 	for _, port := range o.Annotations.Ports {
-		// Each listener has its own priority set
-		var priority int
-
 		// Track down the existing listener for this port
 		var thisListener *listenerP.Listener
 		for _, l := range o.Listeners {
@@ -128,10 +216,34 @@ func NewListenersFromIngress(o *NewListenersFromIngressOptions) (Listeners, erro
 			}
 		}
 
+		// o.Annotations.CertificateArn remains the listener's default
+		// certificate. Additional ARNs (from the certificate-arns annotation
+		// and/or resolved from Ingress.Spec.TLS hosts via ACM) are attached
+		// as SNI certificates alongside it. Copy before appending:
+		// CertificateArns is owned by the shared annotations struct, and
+		// appending to it in place could overwrite another listener's view
+		// of it if the backing array has spare capacity.
+		sniCertificateArns := append([]*string{}, o.Annotations.CertificateArns...)
+		tlsArns, err := resolveTLSCertificateArns(o.Ingress, o.Logger)
+		if err != nil {
+			return nil, err
+		}
+		for _, tlsArn := range tlsArns {
+			if !containsArn(sniCertificateArns, tlsArn) && (o.Annotations.CertificateArn == nil || *o.Annotations.CertificateArn != *tlsArn) {
+				sniCertificateArns = append(sniCertificateArns, tlsArn)
+			}
+		}
+
+		isNLB := o.Annotations.IsNLB()
+
 		newListener := listenerP.NewListener(&listenerP.NewListenerOptions{
-			Port:           port,
-			CertificateArn: o.Annotations.CertificateArn,
-			Logger:         o.Logger,
+			Port:               port,
+			CertificateArn:     o.Annotations.CertificateArn,
+			SNICertificateArns: sniCertificateArns,
+			IsNLB:              isNLB,
+			DefaultBackend:     o.Ingress.Spec.Backend,
+			TargetGroups:       o.TargetGroups,
+			Logger:             o.Logger,
 		})
 
 		if thisListener != nil {
@@ -139,21 +251,76 @@ func NewListenersFromIngress(o *NewListenersFromIngressOptions) (Listeners, erro
 			newListener = thisListener
 		}
 
-		for i, rule := range o.Ingress.Spec.Rules {
-			var err error
-
-			priority = i
-			newListener.Rules, priority, err = rulesP.NewRulesFromIngress(&rulesP.NewRulesFromIngressOptions{
-				Hostname:      rule.Host,
-				Logger:        o.Logger,
-				ListenerRules: newListener.Rules,
-				Rule:          &rule,
-				Priority:      priority,
-			})
-			if err != nil {
-				return nil, err
+		// NLB listeners are a plain TCP/TLS forward to a single target group;
+		// they don't support rules at all, so the Ingress' host/path rules
+		// are meaningless here and are skipped.
+		if !isNLB {
+			// alb.ingress.kubernetes.io/ssl-redirect: "<port>" auto-injects a
+			// priority-1 redirect-to-HTTPS rule on the plain HTTP listener,
+			// ahead of anything coming from the Ingress rules below. Priority
+			// 1 is reserved for it and is never handed out by the allocator.
+			if port.Port == 80 && o.Annotations.SSLRedirect != "" {
+				redirectPort, err := strconv.ParseInt(o.Annotations.SSLRedirect, 10, 64)
+				if err != nil {
+					return nil, fmt.Errorf("invalid ssl-redirect annotation %q: %v", o.Annotations.SSLRedirect, err)
+				}
+				// Register priority 1 with the allocator as held by this
+				// rule. A priority.<service> override of 1 on one of the
+				// Ingress rules below is rejected by Allocate in any case,
+				// since it lies below PriorityBandMin.
+				if err := allocator.Reserve(1, "ssl-redirect"); err != nil {
+					return nil, err
+				}
+				newListener.Rules, _, err = rulesP.NewRulesFromIngress(&rulesP.NewRulesFromIngressOptions{
+					Logger:        o.Logger,
+					ListenerRules: newListener.Rules,
+					Action:        ruleP.NewRedirectAction(redirectPort, "", 301),
+					Priority:      1,
+				})
+				if err != nil {
+					return nil, err
+				}
 			}
 
+			// Each path within an Ingress rule becomes its own ALB rule and
+			// gets its own priority allocated below.
+			for i, rule := range o.Ingress.Spec.Rules {
+				var paths []extensions.HTTPIngressPath
+				if rule.HTTP != nil {
+					paths = rule.HTTP.Paths
+				}
+				if len(paths) == 0 {
+					paths = []extensions.HTTPIngressPath{{}}
+				}
+
+				priorities := make([]int, len(paths))
+				for j, path := range paths {
+					override := o.Annotations.Priorities[path.Backend.ServiceName]
+					priority, err := allocator.Allocate(o.Ingress.Namespace, o.Ingress.Name, i, j, rule.Host, path.Path, override)
+					if err != nil {
+						return nil, err
+					}
+					priorities[j] = priority
+				}
+
+				var err error
+				// Priorities were already allocated per path above; the
+				// next-priority return value has no meaning here and is
+				// intentionally discarded.
+				newListener.Rules, _, err = rulesP.NewRulesFromIngress(&rulesP.NewRulesFromIngressOptions{
+					Hostname:      rule.Host,
+					Logger:        o.Logger,
+					ListenerRules: newListener.Rules,
+					Rule:          &rule,
+					Annotations:   o.Annotations,
+					Priorities:    priorities,
+					TargetGroups:  o.TargetGroups,
+				})
+				if err != nil {
+					return nil, err
+				}
+
+			}
 		}
 		output = append(output, newListener)
 	}
@@ -161,11 +328,54 @@ func NewListenersFromIngress(o *NewListenersFromIngressOptions) (Listeners, erro
 	return output, nil
 }
 
+// resolveTLSCertificateArns matches each Ingress.Spec.TLS.Hosts entry against
+// ACM's certificate inventory, returning the ARN of the certificate that
+// covers it. A host with no matching ACM certificate is skipped rather than
+// treated as an error, since the operator may be relying solely on
+// CertificateArn or CertificateArns for it; any other failure (a throttle, an
+// auth error, ...) is propagated, since silently dropping it would emit an
+// ALB missing its intended SNI certificate with nothing but a debug log to
+// show for it.
+func resolveTLSCertificateArns(ing *extensions.Ingress, logger *log.Logger) ([]*string, error) {
+	var arns []*string
+	for _, tls := range ing.Spec.TLS {
+		for _, host := range tls.Hosts {
+			arn, err := albacm.ACMsvc.CertificateArnForHost(host)
+			if err == albacm.ErrNoMatchingCertificate {
+				logger.Debugf("no ACM certificate found for TLS host %s", host)
+				continue
+			} else if err != nil {
+				return nil, fmt.Errorf("resolving ACM certificate for TLS host %s: %v", host, err)
+			}
+			arns = append(arns, arn)
+		}
+	}
+	return arns, nil
+}
+
+func containsArn(arns []*string, arn *string) bool {
+	if arn == nil {
+		return false
+	}
+	for _, a := range arns {
+		if a != nil && *a == *arn {
+			return true
+		}
+	}
+	return false
+}
+
 type ReconcileOptions struct {
-	Eventf          func(string, string, string, ...interface{})
-	LoadBalancerArn *string
-	Listeners       *Listeners
-	TargetGroups    targetgroups.TargetGroups
+	Eventf           func(string, string, string, ...interface{})
+	LoadBalancerArn  *string
+	Listeners        *Listeners
+	TargetGroups     targetgroups.TargetGroups
+	StatusWriter     *status.Writer
+	IngressNamespace string
+	IngressName      string
+	// IngressCNAME is the value of the CNAME-override annotation, if any. When
+	// set it is written to Ingress status instead of the ALB's own DNS name.
+	IngressCNAME string
 }
 
 func NewReconcileOptions() *ReconcileOptions {
@@ -191,3 +401,20 @@ func (r *ReconcileOptions) SetTargetGroups(targetgroups targetgroups.TargetGroup
 	r.TargetGroups = targetgroups
 	return r
 }
+
+// SetStatusWriter wires in the status writer used to publish the ALB's
+// DNS name back onto the owning Ingress once reconciliation succeeds.
+func (r *ReconcileOptions) SetStatusWriter(w *status.Writer) *ReconcileOptions {
+	r.StatusWriter = w
+	return r
+}
+
+// SetIngress identifies the Ingress whose status should be updated, and
+// optionally a CNAME annotation override to publish instead of the ALB's own
+// DNS name.
+func (r *ReconcileOptions) SetIngress(namespace, name, cname string) *ReconcileOptions {
+	r.IngressNamespace = namespace
+	r.IngressName = name
+	r.IngressCNAME = cname
+	return r
+}
@@ -0,0 +1,109 @@
+package listeners
+
+import (
+	"fmt"
+	"hash/fnv"
+)
+
+// PriorityBandMin and PriorityBandMax bound the range of priorities the
+// PriorityAllocator assigns automatically. ALB rule priorities must be in
+// [1, 50000]; the allocator never returns 1, since that value is reserved for
+// the auto-injected ssl-redirect rule (see the port-80 branch of
+// NewListenersFromIngress).
+const (
+	PriorityBandMin = 2
+	PriorityBandMax = 50000
+)
+
+// PriorityAllocator hands out stable, collision-free rule priorities for
+// rules merged onto the same listener from multiple Ingresses. Without this,
+// NewListenersFromIngress used to assign priority = i from a per-Ingress
+// range-loop index, so two Ingresses sharing a listener would both claim
+// priorities 0..N and reconciliation would churn forever fighting over them.
+//
+// A rule's priority is derived deterministically by hashing its identity
+// (ingress namespace/name, rule index, path index, host, path) into the
+// allocator's band; on collision the hash is perturbed and retried. The
+// result is stable for a fixed allocation order: callers that always
+// Allocate() a given ALB's Ingresses in the same order (e.g. sorted by
+// namespace/name) get the same priorities every reconcile. Feeding the same
+// identity set through in a different order can resolve collisions
+// differently, since later callers probe around whatever earlier callers
+// already reserved.
+type PriorityAllocator struct {
+	taken map[int]string
+}
+
+// NewPriorityAllocator returns an empty PriorityAllocator.
+func NewPriorityAllocator() *PriorityAllocator {
+	return &PriorityAllocator{taken: make(map[int]string)}
+}
+
+// Allocate returns the priority for the rule identified by
+// (ingressNamespace, ingressName, ruleIndex, pathIndex, host, path). If
+// override is > 0 (set via the alb.ingress.kubernetes.io/priority.<service>
+// annotation on the rule's backend) it is used as-is, provided no other rule
+// already holds it; a conflicting override is reported as an error rather
+// than silently displacing whatever was allocated first.
+func (p *PriorityAllocator) Allocate(ingressNamespace, ingressName string, ruleIndex, pathIndex int, host, path string, override int) (int, error) {
+	identity := fmt.Sprintf("%s/%s#%d.%d:%s%s", ingressNamespace, ingressName, ruleIndex, pathIndex, host, path)
+
+	if priority, ok := p.lookup(identity); ok {
+		return priority, nil
+	}
+
+	if override > 0 {
+		if override < PriorityBandMin {
+			return 0, fmt.Errorf("priority %d requested by %s is reserved (priorities below %d are not assignable)", override, identity, PriorityBandMin)
+		}
+		if owner, exists := p.taken[override]; exists && owner != identity {
+			return 0, fmt.Errorf("priority %d requested by %s is already assigned to %s", override, identity, owner)
+		}
+		p.taken[override] = identity
+		return override, nil
+	}
+
+	band := PriorityBandMax - PriorityBandMin + 1
+	h := hash(identity)
+	for i := 0; i < band; i++ {
+		candidate := PriorityBandMin + int((h+uint32(i))%uint32(band))
+		if owner, exists := p.taken[candidate]; !exists || owner == identity {
+			p.taken[candidate] = identity
+			return candidate, nil
+		}
+	}
+
+	// The band is exhausted; this would require tens of thousands of rules
+	// on a single listener, which ALB itself would already have rejected.
+	return 0, fmt.Errorf("no priority available for %s: band %d-%d exhausted", identity, PriorityBandMin, PriorityBandMax)
+}
+
+// Reserve registers priority as already held by owner, so a later Allocate
+// override or Reserve call claiming it for a different owner is rejected as
+// a conflict instead of silently double-assigning it. It records
+// assignments made outside the allocator, e.g. priority 1 for the
+// auto-injected ssl-redirect rule. Allocate rejects overrides below
+// PriorityBandMin on its own, whether or not they were reserved here.
+func (p *PriorityAllocator) Reserve(priority int, owner string) error {
+	if existing, exists := p.taken[priority]; exists && existing != owner {
+		return fmt.Errorf("priority %d requested by %s is already assigned to %s", priority, owner, existing)
+	}
+	p.taken[priority] = owner
+	return nil
+}
+
+// lookup finds a priority already allocated to identity, if any.
+func (p *PriorityAllocator) lookup(identity string) (int, bool) {
+	for priority, owner := range p.taken {
+		if owner == identity {
+			return priority, true
+		}
+	}
+	return 0, false
+}
+
+func hash(s string) uint32 {
+	h := fnv.New32a()
+	_, _ = h.Write([]byte(s))
+	return h.Sum32()
+}
@@ -0,0 +1,84 @@
+package listeners
+
+import "testing"
+
+func TestPriorityAllocatorDeterministic(t *testing.T) {
+	a := NewPriorityAllocator()
+	p1, err := a.Allocate("default", "app", 0, 0, "foo.example.com", "/", 0)
+	if err != nil {
+		t.Fatalf("Allocate: %v", err)
+	}
+
+	b := NewPriorityAllocator()
+	p2, err := b.Allocate("default", "app", 0, 0, "foo.example.com", "/", 0)
+	if err != nil {
+		t.Fatalf("Allocate: %v", err)
+	}
+
+	if p1 != p2 {
+		t.Fatalf("expected same identity to hash to the same priority, got %d and %d", p1, p2)
+	}
+}
+
+func TestPriorityAllocatorSamePathOnSecondAllocate(t *testing.T) {
+	a := NewPriorityAllocator()
+	p1, err := a.Allocate("default", "app", 0, 0, "foo.example.com", "/", 0)
+	if err != nil {
+		t.Fatalf("Allocate: %v", err)
+	}
+	p2, err := a.Allocate("default", "app", 0, 0, "foo.example.com", "/", 0)
+	if err != nil {
+		t.Fatalf("Allocate: %v", err)
+	}
+	if p1 != p2 {
+		t.Fatalf("re-allocating the same rule identity should return the same priority, got %d then %d", p1, p2)
+	}
+}
+
+func TestPriorityAllocatorNoCollisionAcrossRules(t *testing.T) {
+	a := NewPriorityAllocator()
+	seen := make(map[int]bool)
+	for i := 0; i < 50; i++ {
+		p, err := a.Allocate("default", "app", i, 0, "foo.example.com", "/", 0)
+		if err != nil {
+			t.Fatalf("Allocate rule %d: %v", i, err)
+		}
+		if seen[p] {
+			t.Fatalf("priority %d allocated twice", p)
+		}
+		seen[p] = true
+	}
+}
+
+func TestPriorityAllocatorOverrideHonored(t *testing.T) {
+	a := NewPriorityAllocator()
+	p, err := a.Allocate("default", "app", 0, 0, "foo.example.com", "/", 7)
+	if err != nil {
+		t.Fatalf("Allocate: %v", err)
+	}
+	if p != 7 {
+		t.Fatalf("expected override priority 7, got %d", p)
+	}
+}
+
+func TestPriorityAllocatorOverrideConflictRejected(t *testing.T) {
+	a := NewPriorityAllocator()
+	if _, err := a.Allocate("default", "app", 0, 0, "foo.example.com", "/", 7); err != nil {
+		t.Fatalf("Allocate: %v", err)
+	}
+	if _, err := a.Allocate("default", "other", 0, 0, "bar.example.com", "/", 7); err == nil {
+		t.Fatal("expected an error when two rules request the same override priority")
+	}
+}
+
+func TestPriorityAllocatorOverrideDoesNotClobberAutoAllocated(t *testing.T) {
+	a := NewPriorityAllocator()
+	auto, err := a.Allocate("default", "app", 0, 0, "foo.example.com", "/", 0)
+	if err != nil {
+		t.Fatalf("Allocate: %v", err)
+	}
+
+	if _, err := a.Allocate("default", "other", 0, 0, "bar.example.com", "/", auto); err == nil {
+		t.Fatalf("expected an error when an override collides with an already auto-allocated priority %d", auto)
+	}
+}
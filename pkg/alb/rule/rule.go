@@ -0,0 +1,368 @@
+// Package rule reconciles a single ALB listener rule: its priority, its
+// match conditions (host-header, path-pattern, http-header,
+// http-request-method, query-string, source-ip) and its action (forward,
+// redirect or fixed-response).
+package rule
+
+import (
+	"sort"
+	"strconv"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/elbv2"
+	albelbv2 "github.com/coreos/alb-ingress-controller/pkg/aws/elbv2"
+	"github.com/coreos/alb-ingress-controller/pkg/util/log"
+)
+
+// Rule represents the current and desired state of a single ALB rule.
+type Rule struct {
+	CurrentRule *elbv2.Rule
+	DesiredRule *elbv2.Rule
+	Deleted     bool
+
+	logger *log.Logger
+}
+
+// NewRuleFromAWSRule wraps an elbv2.Rule describing a rule already attached
+// to a listener, for comparison against a desired rule during reconciliation.
+func NewRuleFromAWSRule(awsRule *elbv2.Rule, logger *log.Logger) *Rule {
+	return &Rule{CurrentRule: awsRule, logger: logger}
+}
+
+// NewDesiredRuleOptions configures NewDesiredRule.
+type NewDesiredRuleOptions struct {
+	Priority   int
+	Conditions []*elbv2.RuleCondition
+	Action     *elbv2.Action
+	Logger     *log.Logger
+}
+
+// NewDesiredRule builds the Rule a reconcile pass wants a listener to end up
+// with, from a priority, a set of match conditions and a single action.
+func NewDesiredRule(o *NewDesiredRuleOptions) *Rule {
+	return &Rule{
+		DesiredRule: &elbv2.Rule{
+			Priority:   aws.String(strconv.Itoa(o.Priority)),
+			Conditions: o.Conditions,
+			Actions:    []*elbv2.Action{o.Action},
+		},
+		logger: o.Logger,
+	}
+}
+
+// NeedsModification reports whether r's current state differs from its
+// desired state in any field ALB lets us modify (priority, conditions,
+// actions). A rule with no CurrentRule (not yet created) or no DesiredRule
+// (slated for deletion) always needs modification.
+func (r *Rule) NeedsModification() bool {
+	switch {
+	case r.CurrentRule == nil || r.DesiredRule == nil:
+		return true
+	case aws.StringValue(r.CurrentRule.Priority) != aws.StringValue(r.DesiredRule.Priority):
+		return true
+	case !conditionsEqual(r.CurrentRule.Conditions, r.DesiredRule.Conditions):
+		return true
+	case !actionsEqual(r.CurrentRule.Actions, r.DesiredRule.Actions):
+		return true
+	}
+	return false
+}
+
+// ReconcileOptions carries the inputs Rule.Reconcile needs beyond the rule's
+// own Current/DesiredRule fields.
+type ReconcileOptions struct {
+	Eventf      func(string, string, string, ...interface{})
+	ListenerArn *string
+}
+
+func NewReconcileOptions() *ReconcileOptions {
+	return &ReconcileOptions{}
+}
+
+func (r *ReconcileOptions) SetEventf(f func(string, string, string, ...interface{})) *ReconcileOptions {
+	r.Eventf = f
+	return r
+}
+
+func (r *ReconcileOptions) SetListenerArn(arn *string) *ReconcileOptions {
+	r.ListenerArn = arn
+	return r
+}
+
+// Reconcile creates, modifies or deletes the rule against ALB so that its
+// current state matches its desired state.
+func (r *Rule) Reconcile(rOpts *ReconcileOptions) error {
+	switch {
+	case r.DesiredRule == nil && r.CurrentRule != nil:
+		if err := albelbv2.ELBV2svc.DeleteRule(r.CurrentRule.RuleArn); err != nil {
+			return err
+		}
+		r.Deleted = true
+		return nil
+
+	case r.CurrentRule == nil && r.DesiredRule != nil:
+		priority, err := strconv.ParseInt(aws.StringValue(r.DesiredRule.Priority), 10, 64)
+		if err != nil {
+			return err
+		}
+		created, err := albelbv2.ELBV2svc.CreateRule(&elbv2.CreateRuleInput{
+			ListenerArn: rOpts.ListenerArn,
+			Priority:    aws.Int64(priority),
+			Conditions:  r.DesiredRule.Conditions,
+			Actions:     r.DesiredRule.Actions,
+		})
+		if err != nil {
+			return err
+		}
+		r.CurrentRule = created
+		return nil
+
+	case r.NeedsModification():
+		modified, err := albelbv2.ELBV2svc.ModifyRule(&elbv2.ModifyRuleInput{
+			RuleArn:    r.CurrentRule.RuleArn,
+			Conditions: r.DesiredRule.Conditions,
+			Actions:    r.DesiredRule.Actions,
+		})
+		if err != nil {
+			return err
+		}
+		r.CurrentRule = modified
+		return nil
+	}
+
+	return nil
+}
+
+// NewForwardAction returns an action that forwards to the target group
+// identified by targetGroupArn.
+func NewForwardAction(targetGroupArn *string) *elbv2.Action {
+	return &elbv2.Action{
+		Type:           aws.String(elbv2.ActionTypeEnumForward),
+		TargetGroupArn: targetGroupArn,
+	}
+}
+
+// NewRedirectAction returns an action that redirects to the same host/path,
+// on redirectPort, with the given status code (301 or 302). host overrides
+// the request's own host if non-empty; "" means "keep the original host"
+// (ALB's "#{host}" token).
+func NewRedirectAction(redirectPort int64, host string, statusCode int64) *elbv2.Action {
+	if host == "" {
+		host = "#{host}"
+	}
+	return &elbv2.Action{
+		Type: aws.String(elbv2.ActionTypeEnumRedirect),
+		RedirectConfig: &elbv2.RedirectActionConfig{
+			Host:       aws.String(host),
+			Path:       aws.String("/#{path}"),
+			Port:       aws.String(strconv.FormatInt(redirectPort, 10)),
+			Protocol:   aws.String("HTTPS"),
+			Query:      aws.String("#{query}"),
+			StatusCode: aws.String(redirectStatusCodeName(statusCode)),
+		},
+	}
+}
+
+// NewFixedResponseAction returns an action that answers matching requests
+// directly with statusCode, contentType and messageBody instead of
+// forwarding them to a target group.
+func NewFixedResponseAction(statusCode int64, contentType, messageBody string) *elbv2.Action {
+	return &elbv2.Action{
+		Type: aws.String(elbv2.ActionTypeEnumFixedResponse),
+		FixedResponseConfig: &elbv2.FixedResponseActionConfig{
+			StatusCode:  aws.String(strconv.FormatInt(statusCode, 10)),
+			ContentType: aws.String(contentType),
+			MessageBody: aws.String(messageBody),
+		},
+	}
+}
+
+func redirectStatusCodeName(statusCode int64) string {
+	if statusCode == 302 {
+		return elbv2.RedirectActionStatusCodeEnumHttp302
+	}
+	return elbv2.RedirectActionStatusCodeEnumHttp301
+}
+
+// NewHostHeaderCondition matches requests whose Host header is one of hosts.
+func NewHostHeaderCondition(hosts []string) *elbv2.RuleCondition {
+	return &elbv2.RuleCondition{
+		Field:            aws.String("host-header"),
+		HostHeaderConfig: &elbv2.HostHeaderConditionConfig{Values: aws.StringSlice(hosts)},
+	}
+}
+
+// NewPathPatternCondition matches requests whose path matches one of paths.
+func NewPathPatternCondition(paths []string) *elbv2.RuleCondition {
+	return &elbv2.RuleCondition{
+		Field:             aws.String("path-pattern"),
+		PathPatternConfig: &elbv2.PathPatternConditionConfig{Values: aws.StringSlice(paths)},
+	}
+}
+
+// NewHTTPHeaderCondition matches requests carrying the named header with one
+// of values.
+func NewHTTPHeaderCondition(name string, values []string) *elbv2.RuleCondition {
+	return &elbv2.RuleCondition{
+		Field: aws.String("http-header"),
+		HttpHeaderConfig: &elbv2.HttpHeaderConditionConfig{
+			HttpHeaderName: aws.String(name),
+			Values:         aws.StringSlice(values),
+		},
+	}
+}
+
+// NewHTTPRequestMethodCondition matches requests using one of methods
+// (e.g. "GET", "POST").
+func NewHTTPRequestMethodCondition(methods []string) *elbv2.RuleCondition {
+	return &elbv2.RuleCondition{
+		Field:                   aws.String("http-request-method"),
+		HttpRequestMethodConfig: &elbv2.HttpRequestMethodConditionConfig{Values: aws.StringSlice(methods)},
+	}
+}
+
+// NewQueryStringCondition matches requests whose query string contains every
+// key/value pair in values.
+func NewQueryStringCondition(values map[string]string) *elbv2.RuleCondition {
+	pairs := make([]*elbv2.QueryStringKeyValuePair, 0, len(values))
+	// Range over a map is non-deterministic; sort the keys so repeated
+	// conversions of the same annotation produce an identical RuleCondition
+	// and NeedsModification doesn't see a spurious diff.
+	keys := make([]string, 0, len(values))
+	for k := range values {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	for _, k := range keys {
+		pairs = append(pairs, &elbv2.QueryStringKeyValuePair{Key: aws.String(k), Value: aws.String(values[k])})
+	}
+	return &elbv2.RuleCondition{
+		Field:             aws.String("query-string"),
+		QueryStringConfig: &elbv2.QueryStringConditionConfig{Values: pairs},
+	}
+}
+
+// NewSourceIPCondition matches requests originating from one of cidrs.
+func NewSourceIPCondition(cidrs []string) *elbv2.RuleCondition {
+	return &elbv2.RuleCondition{
+		Field:          aws.String("source-ip"),
+		SourceIpConfig: &elbv2.SourceIpConditionConfig{Values: aws.StringSlice(cidrs)},
+	}
+}
+
+func conditionsEqual(a, b []*elbv2.RuleCondition) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if aws.StringValue(a[i].Field) != aws.StringValue(b[i].Field) {
+			return false
+		}
+		if !stringSlicesEqualUnordered(valuesOf(a[i]), valuesOf(b[i])) {
+			return false
+		}
+	}
+	return true
+}
+
+// valuesOf returns the effective match values for c regardless of which
+// Field it is, so conditionsEqual doesn't need a case per condition type.
+func valuesOf(c *elbv2.RuleCondition) []string {
+	switch aws.StringValue(c.Field) {
+	case "host-header":
+		if c.HostHeaderConfig != nil {
+			return aws.StringValueSlice(c.HostHeaderConfig.Values)
+		}
+	case "path-pattern":
+		if c.PathPatternConfig != nil {
+			return aws.StringValueSlice(c.PathPatternConfig.Values)
+		}
+	case "http-header":
+		if c.HttpHeaderConfig != nil {
+			return append([]string{aws.StringValue(c.HttpHeaderConfig.HttpHeaderName)}, aws.StringValueSlice(c.HttpHeaderConfig.Values)...)
+		}
+	case "http-request-method":
+		if c.HttpRequestMethodConfig != nil {
+			return aws.StringValueSlice(c.HttpRequestMethodConfig.Values)
+		}
+	case "source-ip":
+		if c.SourceIpConfig != nil {
+			return aws.StringValueSlice(c.SourceIpConfig.Values)
+		}
+	case "query-string":
+		if c.QueryStringConfig != nil {
+			var out []string
+			for _, pair := range c.QueryStringConfig.Values {
+				out = append(out, aws.StringValue(pair.Key)+"="+aws.StringValue(pair.Value))
+			}
+			return out
+		}
+	}
+	return aws.StringValueSlice(c.Values)
+}
+
+func actionsEqual(a, b []*elbv2.Action) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if aws.StringValue(a[i].Type) != aws.StringValue(b[i].Type) {
+			return false
+		}
+		switch aws.StringValue(a[i].Type) {
+		case elbv2.ActionTypeEnumForward:
+			if aws.StringValue(a[i].TargetGroupArn) != aws.StringValue(b[i].TargetGroupArn) {
+				return false
+			}
+		case elbv2.ActionTypeEnumRedirect:
+			if !redirectConfigEqual(a[i].RedirectConfig, b[i].RedirectConfig) {
+				return false
+			}
+		case elbv2.ActionTypeEnumFixedResponse:
+			if !fixedResponseConfigEqual(a[i].FixedResponseConfig, b[i].FixedResponseConfig) {
+				return false
+			}
+		}
+	}
+	return true
+}
+
+func redirectConfigEqual(a, b *elbv2.RedirectActionConfig) bool {
+	if a == nil || b == nil {
+		return a == b
+	}
+	return aws.StringValue(a.Host) == aws.StringValue(b.Host) &&
+		aws.StringValue(a.Path) == aws.StringValue(b.Path) &&
+		aws.StringValue(a.Port) == aws.StringValue(b.Port) &&
+		aws.StringValue(a.Protocol) == aws.StringValue(b.Protocol) &&
+		aws.StringValue(a.Query) == aws.StringValue(b.Query) &&
+		aws.StringValue(a.StatusCode) == aws.StringValue(b.StatusCode)
+}
+
+func fixedResponseConfigEqual(a, b *elbv2.FixedResponseActionConfig) bool {
+	if a == nil || b == nil {
+		return a == b
+	}
+	return aws.StringValue(a.StatusCode) == aws.StringValue(b.StatusCode) &&
+		aws.StringValue(a.ContentType) == aws.StringValue(b.ContentType) &&
+		aws.StringValue(a.MessageBody) == aws.StringValue(b.MessageBody)
+}
+
+func stringSlicesEqualUnordered(a, b []string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	counts := make(map[string]int, len(a))
+	for _, s := range a {
+		counts[s]++
+	}
+	for _, s := range b {
+		counts[s]--
+	}
+	for _, c := range counts {
+		if c != 0 {
+			return false
+		}
+	}
+	return true
+}
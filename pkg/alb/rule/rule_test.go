@@ -0,0 +1,83 @@
+package rule
+
+import (
+	"testing"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/elbv2"
+)
+
+// TestConditionsRoundTrip builds one of every condition type, round-trips it
+// through an elbv2.Rule the way AWS would hand it back from DescribeRules,
+// and checks that comparing the result against the same conditions again
+// reports no modification needed. This guards against a condition
+// constructor and conditionsEqual silently disagreeing on what a condition
+// "is" (e.g. one comparing Values, the other a type-specific Config).
+func TestConditionsRoundTrip(t *testing.T) {
+	conditions := []*elbv2.RuleCondition{
+		NewHostHeaderCondition([]string{"example.com", "other.example.com"}),
+		NewPathPatternCondition([]string{"/foo", "/foo/*"}),
+		NewHTTPHeaderCondition("X-Forwarded-For", []string{"10.0.0.1"}),
+		NewHTTPRequestMethodCondition([]string{"GET", "POST"}),
+		NewQueryStringCondition(map[string]string{"b": "2", "a": "1"}),
+		NewSourceIPCondition([]string{"10.0.0.0/8"}),
+	}
+
+	current := &Rule{CurrentRule: &elbv2.Rule{
+		Priority:   aws.String("5"),
+		Conditions: conditions,
+		Actions:    []*elbv2.Action{NewForwardAction(aws.String("arn:tg"))},
+	}}
+	desired := NewDesiredRule(&NewDesiredRuleOptions{
+		Priority:   5,
+		Conditions: conditions,
+		Action:     NewForwardAction(aws.String("arn:tg")),
+	})
+	current.DesiredRule = desired.DesiredRule
+
+	if current.NeedsModification() {
+		t.Fatalf("expected no modification needed when conditions are reapplied unchanged")
+	}
+}
+
+func TestConditionsRoundTripDetectsChange(t *testing.T) {
+	current := &Rule{
+		CurrentRule: &elbv2.Rule{
+			Priority:   aws.String("5"),
+			Conditions: []*elbv2.RuleCondition{NewHostHeaderCondition([]string{"example.com"})},
+			Actions:    []*elbv2.Action{NewForwardAction(aws.String("arn:tg"))},
+		},
+		DesiredRule: &elbv2.Rule{
+			Priority:   aws.String("5"),
+			Conditions: []*elbv2.RuleCondition{NewHostHeaderCondition([]string{"other.example.com"})},
+			Actions:    []*elbv2.Action{NewForwardAction(aws.String("arn:tg"))},
+		},
+	}
+	if !current.NeedsModification() {
+		t.Fatalf("expected a changed host-header condition to need modification")
+	}
+}
+
+func TestActionsEqual(t *testing.T) {
+	cases := []struct {
+		name string
+		a, b *elbv2.Action
+		want bool
+	}{
+		{"forward same arn", NewForwardAction(aws.String("arn:a")), NewForwardAction(aws.String("arn:a")), true},
+		{"forward different arn", NewForwardAction(aws.String("arn:a")), NewForwardAction(aws.String("arn:b")), false},
+		{"redirect same", NewRedirectAction(443, "", 301), NewRedirectAction(443, "", 301), true},
+		{"redirect different port", NewRedirectAction(443, "", 301), NewRedirectAction(8443, "", 301), false},
+		{"fixed-response same", NewFixedResponseAction(404, "text/plain", "nope"), NewFixedResponseAction(404, "text/plain", "nope"), true},
+		{"fixed-response different body", NewFixedResponseAction(404, "text/plain", "nope"), NewFixedResponseAction(404, "text/plain", "gone"), false},
+		{"different type", NewForwardAction(aws.String("arn:a")), NewFixedResponseAction(404, "text/plain", "nope"), false},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			if got := actionsEqual([]*elbv2.Action{c.a}, []*elbv2.Action{c.b}); got != c.want {
+				t.Errorf("actionsEqual(%v, %v) = %v, want %v", c.a, c.b, got, c.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,206 @@
+// Package rules assembles the set of ALB rules a listener needs from an
+// Ingress (merging its host/path rules with any conditions/actions
+// annotations) and reconciles that set against the listener's current rules.
+package rules
+
+import (
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/elbv2"
+	ruleP "github.com/coreos/alb-ingress-controller/pkg/alb/rule"
+	"github.com/coreos/alb-ingress-controller/pkg/alb/targetgroups"
+	"github.com/coreos/alb-ingress-controller/pkg/annotations"
+	"github.com/coreos/alb-ingress-controller/pkg/util/log"
+	extensions "k8s.io/api/extensions/v1beta1"
+)
+
+// Rules is every rule attached to a single listener.
+type Rules []*ruleP.Rule
+
+// NewRulesFromIngressOptions configures NewRulesFromIngress. Either Rule or
+// Action must be set: Rule derives one ALB rule per HTTP path (the normal
+// case), while Action alone describes a sentinel rule with no host/path
+// conditions that applies to every request on the listener (used for the
+// auto-injected ssl-redirect rule).
+type NewRulesFromIngressOptions struct {
+	Hostname      string
+	Logger        *log.Logger
+	ListenerRules Rules
+
+	// Rule, when set, derives one ALB rule per path in Rule.HTTP.Paths (or a
+	// single rule with no path-pattern condition if Rule.HTTP is nil/empty).
+	Rule *extensions.IngressRule
+	// Priorities holds one priority per path in Rule.HTTP.Paths, already
+	// allocated by listeners.PriorityAllocator. Ignored when Rule is nil.
+	Priorities []int
+	// Annotations supplies the conditions.<service-name> and
+	// actions.<service-name> overrides merged into each path's rule, and the
+	// priority.<service-name> overrides already folded into Priorities by the
+	// caller. Ignored when Rule is nil.
+	Annotations *annotations.Annotations
+	// TargetGroups resolves a backend's (serviceName, servicePort) to the ARN
+	// used by the default forward action, when no actions.<service-name>
+	// annotation overrides it.
+	TargetGroups targetgroups.TargetGroups
+
+	// Action and Priority, when Rule is nil, describe the sentinel rule
+	// directly.
+	Action   *elbv2.Action
+	Priority int
+}
+
+// NewRulesFromIngress returns o.ListenerRules with the rule(s) described by
+// o merged in (replacing any existing rule at the same priority), plus one
+// past the highest priority just added (or o.Priority, if that is higher),
+// for a caller that wants to keep allocating past it.
+func NewRulesFromIngress(o *NewRulesFromIngressOptions) (Rules, int, error) {
+	listenerRules := o.ListenerRules
+
+	if o.Rule == nil {
+		r := ruleP.NewDesiredRule(&ruleP.NewDesiredRuleOptions{
+			Priority: o.Priority,
+			Action:   o.Action,
+			Logger:   o.Logger,
+		})
+		return upsertRule(listenerRules, r), o.Priority + 1, nil
+	}
+
+	var paths []extensions.HTTPIngressPath
+	if o.Rule.HTTP != nil {
+		paths = o.Rule.HTTP.Paths
+	}
+	if len(paths) == 0 {
+		paths = []extensions.HTTPIngressPath{{}}
+	}
+
+	nextPriority := o.Priority
+	for i, path := range paths {
+		priority := o.Priority
+		if i < len(o.Priorities) {
+			priority = o.Priorities[i]
+		}
+		if priority >= nextPriority {
+			nextPriority = priority + 1
+		}
+
+		var conditions []*elbv2.RuleCondition
+		if o.Hostname != "" {
+			conditions = append(conditions, ruleP.NewHostHeaderCondition([]string{o.Hostname}))
+		}
+		if path.Path != "" {
+			conditions = append(conditions, ruleP.NewPathPatternCondition([]string{path.Path}))
+		}
+		if o.Annotations != nil {
+			conditions = append(conditions, o.Annotations.Conditions[path.Backend.ServiceName]...)
+		}
+
+		r := ruleP.NewDesiredRule(&ruleP.NewDesiredRuleOptions{
+			Priority:   priority,
+			Conditions: conditions,
+			Action:     o.actionFor(path.Backend),
+			Logger:     o.Logger,
+		})
+		listenerRules = upsertRule(listenerRules, r)
+	}
+
+	return listenerRules, nextPriority, nil
+}
+
+// actionFor returns the actions.<service-name> override for backend if one
+// was set, and otherwise a forward action to its target group.
+func (o *NewRulesFromIngressOptions) actionFor(backend extensions.IngressBackend) *elbv2.Action {
+	if o.Annotations != nil {
+		if action, ok := o.Annotations.Actions[backend.ServiceName]; ok {
+			return action
+		}
+	}
+	var tgArn *string
+	if o.TargetGroups != nil {
+		tgArn = o.TargetGroups.Arn(backend.ServiceName, int32(backend.ServicePort.IntValue()))
+	}
+	return ruleP.NewForwardAction(tgArn)
+}
+
+// upsertRule replaces the rule in rs sharing r's priority with r, or appends
+// r if none matches, so a rule already reconciled (and carrying a
+// CurrentRule) is reused across reconcile passes instead of being rebuilt
+// from scratch every time.
+func upsertRule(rs Rules, r *ruleP.Rule) Rules {
+	for _, existing := range rs {
+		if rulePriority(existing) == aws.StringValue(r.DesiredRule.Priority) {
+			existing.DesiredRule = r.DesiredRule
+			return rs
+		}
+	}
+	return append(rs, r)
+}
+
+func rulePriority(r *ruleP.Rule) string {
+	if r.CurrentRule != nil {
+		return aws.StringValue(r.CurrentRule.Priority)
+	}
+	if r.DesiredRule != nil {
+		return aws.StringValue(r.DesiredRule.Priority)
+	}
+	return ""
+}
+
+// ReconcileOptions carries the inputs Rules.Reconcile needs to reconcile
+// each of its Rules against ALB.
+type ReconcileOptions struct {
+	Eventf       func(string, string, string, ...interface{})
+	ListenerArn  *string
+	TargetGroups targetgroups.TargetGroups
+}
+
+func NewReconcileOptions() *ReconcileOptions {
+	return &ReconcileOptions{}
+}
+
+func (r *ReconcileOptions) SetEventf(f func(string, string, string, ...interface{})) *ReconcileOptions {
+	r.Eventf = f
+	return r
+}
+
+func (r *ReconcileOptions) SetListenerArn(arn *string) *ReconcileOptions {
+	r.ListenerArn = arn
+	return r
+}
+
+func (r *ReconcileOptions) SetTargetGroups(tgs targetgroups.TargetGroups) *ReconcileOptions {
+	r.TargetGroups = tgs
+	return r
+}
+
+// Reconcile reconciles every rule in rs against ALB, returning the surviving
+// set (deleted rules dropped) and whether any rule was actually created,
+// modified or deleted. Callers use the changed flag to decide whether a
+// DescribeRules cache entry for this listener is now stale.
+func (rs Rules) Reconcile(rOpts *ReconcileOptions) (Rules, bool, error) {
+	var output Rules
+	changed := false
+
+	ruleOpts := ruleP.NewReconcileOptions().SetEventf(rOpts.Eventf).SetListenerArn(rOpts.ListenerArn)
+
+	for _, r := range rs {
+		if r.NeedsModification() {
+			changed = true
+		}
+		if err := r.Reconcile(ruleOpts); err != nil {
+			return nil, false, err
+		}
+		if !r.Deleted {
+			output = append(output, r)
+		}
+	}
+
+	return output, changed, nil
+}
+
+// StripCurrentState clears every rule's CurrentRule, used when the owning
+// listener (and therefore every rule on it) has already been deleted from
+// ALB and the controller must not believe it still exists.
+func (rs Rules) StripCurrentState() {
+	for _, r := range rs {
+		r.CurrentRule = nil
+	}
+}
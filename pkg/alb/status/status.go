@@ -0,0 +1,163 @@
+// Package status keeps Ingress.Status.LoadBalancer.Ingress in sync with the
+// DNS name of the ALB a given Ingress resolves to. Reconciling listeners
+// tells us an ALB exists and is healthy, but it never mutates the Ingress
+// object itself, so kubectl get ingress would otherwise always show an empty
+// ADDRESS column. This is inspired by Contour's IngressStatusWriter, though
+// the debounce itself is simpler: each Ingress key gets its own
+// time.AfterFunc timer, reset on every Schedule/Clear call, with no shared
+// worker and no batching across keys. That's enough to collapse a burst of
+// reconciles for one Ingress into a single patch call; it does nothing for
+// bursts that span many Ingresses at once.
+package status
+
+import (
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/coreos/alb-ingress-controller/pkg/util/log"
+	"k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+)
+
+// flushRetries bounds how many times flush retries a status update that lost
+// an optimistic-concurrency race (a 409 Conflict from UpdateStatus) against
+// another writer of the same Ingress, re-fetching and reapplying each time
+// rather than dropping the update on the first conflict.
+const flushRetries = 3
+
+// DefaultDebounce is how long Writer waits after the last Schedule call for
+// a given Ingress before it actually issues the status patch, so that a burst
+// of reconciles (e.g. several listeners settling in quick succession) results
+// in a single API call.
+const DefaultDebounce = 1 * time.Second
+
+// key identifies the Ingress an update is destined for.
+type key struct {
+	Namespace string
+	Name      string
+}
+
+func (k key) String() string {
+	return fmt.Sprintf("%s/%s", k.Namespace, k.Name)
+}
+
+// update is the desired status for a single Ingress. A nil *update means
+// "clear the status", used when the Ingress or its ALB is deleted.
+type update struct {
+	dnsName string
+	cname   string
+}
+
+// Writer batches and debounces Ingress status updates so that
+// listeners.Listeners.Reconcile can fire-and-forget whenever the listener set
+// for an Ingress changes.
+type Writer struct {
+	client   kubernetes.Interface
+	logger   *log.Logger
+	debounce time.Duration
+	mutex    sync.Mutex
+	pending  map[key]*update
+	timers   map[key]*time.Timer
+}
+
+// NewWriter returns a Writer that patches Ingress status through client.
+func NewWriter(client kubernetes.Interface, logger *log.Logger) *Writer {
+	return &Writer{
+		client:   client,
+		logger:   logger,
+		debounce: DefaultDebounce,
+		pending:  make(map[key]*update),
+		timers:   make(map[key]*time.Timer),
+	}
+}
+
+// Schedule queues an Ingress status update for namespace/name pointing at
+// dnsName. If cname is non-empty (set via a user CNAME-override annotation)
+// it is written instead of dnsName. The actual API call happens at most once
+// per debounce window.
+func (w *Writer) Schedule(namespace, name, dnsName, cname string) {
+	w.enqueue(key{Namespace: namespace, Name: name}, &update{dnsName: dnsName, cname: cname})
+}
+
+// Clear queues removal of the Ingress status, used when the Ingress or its
+// backing ALB has been deleted.
+func (w *Writer) Clear(namespace, name string) {
+	w.enqueue(key{Namespace: namespace, Name: name}, nil)
+}
+
+func (w *Writer) enqueue(k key, u *update) {
+	w.mutex.Lock()
+	defer w.mutex.Unlock()
+
+	w.pending[k] = u
+	if t, ok := w.timers[k]; ok {
+		t.Stop()
+	}
+	w.timers[k] = time.AfterFunc(w.debounce, func() { w.flush(k) })
+}
+
+func (w *Writer) flush(k key) {
+	w.mutex.Lock()
+	u, ok := w.pending[k]
+	delete(w.pending, k)
+	delete(w.timers, k)
+	w.mutex.Unlock()
+
+	if !ok {
+		return
+	}
+
+	var lbIngress []v1.LoadBalancerIngress
+	if u != nil {
+		host := u.dnsName
+		if u.cname != "" {
+			host = u.cname
+		}
+		lbIngress = []v1.LoadBalancerIngress{{Hostname: host}}
+	}
+
+	for attempt := 0; attempt <= flushRetries; attempt++ {
+		ingress, err := w.client.ExtensionsV1beta1().Ingresses(k.Namespace).Get(k.Name, metav1.GetOptions{})
+		if err != nil {
+			w.logger.Errorf("failed fetching ingress %s for status update: %v", k, err)
+			return
+		}
+
+		if loadBalancerIngressEqual(ingress.Status.LoadBalancer.Ingress, lbIngress) {
+			return
+		}
+
+		ingress.Status.LoadBalancer.Ingress = lbIngress
+		_, err = w.client.ExtensionsV1beta1().Ingresses(k.Namespace).UpdateStatus(ingress)
+		if err == nil {
+			return
+		}
+		if !apierrors.IsConflict(err) {
+			w.logger.Errorf("failed updating status for ingress %s: %v", k, err)
+			return
+		}
+		// Another writer updated this Ingress between our Get and our
+		// UpdateStatus; re-fetch and reapply rather than dropping the
+		// update, since a dropped update here means kubectl get ingress
+		// keeps showing a stale or empty ADDRESS indefinitely.
+		if attempt < flushRetries {
+			w.logger.Debugf("status update for ingress %s conflicted, retrying (attempt %d/%d)", k, attempt+1, flushRetries)
+		}
+	}
+	w.logger.Errorf("failed updating status for ingress %s after %d attempts: too many conflicts", k, flushRetries+1)
+}
+
+func loadBalancerIngressEqual(a, b []v1.LoadBalancerIngress) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i].Hostname != b[i].Hostname || a[i].IP != b[i].IP {
+			return false
+		}
+	}
+	return true
+}
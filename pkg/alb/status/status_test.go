@@ -0,0 +1,39 @@
+package status
+
+import (
+	"testing"
+
+	"k8s.io/api/core/v1"
+)
+
+// This only covers the pure comparison Writer.flush relies on to skip no-op
+// status patches; flush itself, which talks to the API server through a
+// kubernetes.Interface, is not exercised here.
+func TestLoadBalancerIngressEqual(t *testing.T) {
+	cases := []struct {
+		name string
+		a, b []v1.LoadBalancerIngress
+		want bool
+	}{
+		{"both empty", nil, nil, true},
+		{"same hostname", []v1.LoadBalancerIngress{{Hostname: "alb.example.com"}}, []v1.LoadBalancerIngress{{Hostname: "alb.example.com"}}, true},
+		{"different hostname", []v1.LoadBalancerIngress{{Hostname: "alb.example.com"}}, []v1.LoadBalancerIngress{{Hostname: "other.example.com"}}, false},
+		{"different length", []v1.LoadBalancerIngress{{Hostname: "alb.example.com"}}, nil, false},
+		{"different ip", []v1.LoadBalancerIngress{{IP: "1.2.3.4"}}, []v1.LoadBalancerIngress{{IP: "5.6.7.8"}}, false},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			if got := loadBalancerIngressEqual(c.a, c.b); got != c.want {
+				t.Errorf("loadBalancerIngressEqual(%v, %v) = %v, want %v", c.a, c.b, got, c.want)
+			}
+		})
+	}
+}
+
+func TestKeyString(t *testing.T) {
+	k := key{Namespace: "default", Name: "app"}
+	if got, want := k.String(), "default/app"; got != want {
+		t.Errorf("key.String() = %q, want %q", got, want)
+	}
+}
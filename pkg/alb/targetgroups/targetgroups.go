@@ -0,0 +1,26 @@
+// Package targetgroups tracks the target groups backing a single ALB, so
+// that rules and NLB listeners can resolve an Ingress backend's
+// (serviceName, servicePort) pair to the ARN of the target group that
+// fronts it without each caller re-deriving the group's name.
+package targetgroups
+
+// TargetGroup is a single target group backing one Ingress backend.
+type TargetGroup struct {
+	SvcName string
+	SvcPort int32
+	Arn     *string
+}
+
+// TargetGroups is every target group backing a single ALB.
+type TargetGroups []*TargetGroup
+
+// Arn returns the ARN of the target group backing (svcName, svcPort), or nil
+// if no such target group has been created yet.
+func (t TargetGroups) Arn(svcName string, svcPort int32) *string {
+	for _, tg := range t {
+		if tg.SvcName == svcName && tg.SvcPort == svcPort {
+			return tg.Arn
+		}
+	}
+	return nil
+}
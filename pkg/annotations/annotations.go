@@ -0,0 +1,71 @@
+// Package annotations parses the alb.ingress.kubernetes.io/* annotation
+// family off an Ingress into the typed values the alb/* packages consume, so
+// none of them have to deal with raw map[string]string lookups or repeat the
+// same parsing/defaulting logic.
+package annotations
+
+import (
+	"strings"
+
+	"github.com/aws/aws-sdk-go/service/elbv2"
+)
+
+// PortData is a single listener port/scheme pair, as parsed from the
+// alb.ingress.kubernetes.io/listen-ports annotation (e.g. `[{"HTTP": 80},
+// {"HTTPS": 443}]`).
+type PortData struct {
+	Scheme string
+	Port   int64
+}
+
+// Annotations holds the parsed alb.ingress.kubernetes.io/* values for a
+// single Ingress. Fields default to their zero value when the corresponding
+// annotation is absent; callers treat an empty/zero field as "not set"
+// rather than erroring.
+type Annotations struct {
+	// Ports lists every listener this Ingress wants, one per
+	// listen-ports entry.
+	Ports []PortData
+
+	// CertificateArn is the default (non-SNI) certificate attached to HTTPS/TLS
+	// listeners, from certificate-arn.
+	CertificateArn *string
+	// CertificateArns lists additional certificates attached as SNI certs
+	// alongside CertificateArn, from certificate-arns.
+	CertificateArns []*string
+
+	// LoadBalancerType selects ALB (the default) or NLB provisioning, from
+	// load-balancer-type. Use IsNLB rather than comparing this directly, since
+	// the annotation's value is matched case- and whitespace-insensitively.
+	LoadBalancerType string
+
+	// SSLRedirect is the target HTTPS port for the auto-injected ssl-redirect
+	// rule on the plain HTTP listener, from ssl-redirect. Empty means no
+	// redirect rule is injected.
+	SSLRedirect string
+
+	// Priorities maps a backend service name to the rule priority requested
+	// for it via priority.<service-name>. Services with no override are
+	// absent from the map (looking up a missing key returns 0, meaning
+	// "auto-allocate").
+	Priorities map[string]int
+
+	// Conditions maps a backend service name to the extra match conditions
+	// requested for it via conditions.<service-name>, merged with the
+	// host/path conditions derived from the Ingress rule itself. Services
+	// with no annotation are absent from the map.
+	Conditions map[string][]*elbv2.RuleCondition
+
+	// Actions maps a backend service name to the non-forward action
+	// requested for it via actions.<service-name> (redirect or
+	// fixed-response). Services with no annotation are absent from the map
+	// and get the default forward-to-target-group action.
+	Actions map[string]*elbv2.Action
+}
+
+// IsNLB reports whether LoadBalancerType selects NLB provisioning. The
+// comparison is case- and whitespace-insensitive, since "NLB"/" nlb " are
+// easy operator typos that shouldn't silently fall back to ALB mode.
+func (a *Annotations) IsNLB() bool {
+	return strings.EqualFold(strings.TrimSpace(a.LoadBalancerType), "nlb")
+}
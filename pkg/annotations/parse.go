@@ -0,0 +1,91 @@
+package annotations
+
+import (
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/aws/aws-sdk-go/service/elbv2"
+)
+
+const (
+	prefix              = "alb.ingress.kubernetes.io/"
+	certificateArnKey   = prefix + "certificate-arn"
+	certificateArnsKey  = prefix + "certificate-arns"
+	loadBalancerTypeKey = prefix + "load-balancer-type"
+	sslRedirectKey      = prefix + "ssl-redirect"
+	listenPortsKey      = prefix + "listen-ports"
+	priorityPrefix      = prefix + "priority."
+	conditionsPrefix    = prefix + "conditions."
+	actionsPrefix       = prefix + "actions."
+)
+
+// ParseAnnotations builds an Annotations from an Ingress' raw
+// metadata.annotations map. Annotations it doesn't recognize are ignored;
+// recognized annotations with a value that can't be parsed (bad JSON, a
+// non-integer priority, ...) are reported as an error rather than silently
+// dropped, since an operator-facing typo there should fail loudly instead of
+// reconciling as if the annotation were never set.
+func ParseAnnotations(raw map[string]string) (*Annotations, error) {
+	a := &Annotations{
+		Priorities: make(map[string]int),
+		Conditions: make(map[string][]*elbv2.RuleCondition),
+		Actions:    make(map[string]*elbv2.Action),
+	}
+
+	if v, ok := raw[certificateArnKey]; ok {
+		a.CertificateArn = &v
+	}
+	if v, ok := raw[certificateArnsKey]; ok {
+		for _, part := range strings.Split(v, ",") {
+			if arn := strings.TrimSpace(part); arn != "" {
+				a.CertificateArns = append(a.CertificateArns, &arn)
+			}
+		}
+	}
+	a.LoadBalancerType = raw[loadBalancerTypeKey]
+	a.SSLRedirect = raw[sslRedirectKey]
+
+	if v, ok := raw[listenPortsKey]; ok {
+		var entries []map[string]int64
+		if err := json.Unmarshal([]byte(v), &entries); err != nil {
+			return nil, fmt.Errorf("parsing %s: %v", listenPortsKey, err)
+		}
+		for _, entry := range entries {
+			for scheme, port := range entry {
+				a.Ports = append(a.Ports, PortData{Scheme: scheme, Port: port})
+			}
+		}
+	}
+
+	for key, value := range raw {
+		switch {
+		case strings.HasPrefix(key, priorityPrefix):
+			svc := strings.TrimPrefix(key, priorityPrefix)
+			priority, err := strconv.Atoi(value)
+			if err != nil {
+				return nil, fmt.Errorf("parsing %s: %v", key, err)
+			}
+			a.Priorities[svc] = priority
+
+		case strings.HasPrefix(key, conditionsPrefix):
+			svc := strings.TrimPrefix(key, conditionsPrefix)
+			var conditions []*elbv2.RuleCondition
+			if err := json.Unmarshal([]byte(value), &conditions); err != nil {
+				return nil, fmt.Errorf("parsing %s: %v", key, err)
+			}
+			a.Conditions[svc] = conditions
+
+		case strings.HasPrefix(key, actionsPrefix):
+			svc := strings.TrimPrefix(key, actionsPrefix)
+			var action elbv2.Action
+			if err := json.Unmarshal([]byte(value), &action); err != nil {
+				return nil, fmt.Errorf("parsing %s: %v", key, err)
+			}
+			a.Actions[svc] = &action
+		}
+	}
+
+	return a, nil
+}
@@ -0,0 +1,83 @@
+package annotations
+
+import (
+	"testing"
+
+	"github.com/aws/aws-sdk-go/aws"
+)
+
+func TestParseAnnotationsConditions(t *testing.T) {
+	raw := map[string]string{
+		conditionsPrefix + "my-service": `[
+			{"field":"http-header","httpHeaderConfig":{"httpHeaderName":"X-Foo","values":["bar"]}},
+			{"field":"query-string","queryStringConfig":{"values":[{"key":"a","value":"1"}]}}
+		]`,
+	}
+
+	a, err := ParseAnnotations(raw)
+	if err != nil {
+		t.Fatalf("ParseAnnotations: %v", err)
+	}
+
+	conditions, ok := a.Conditions["my-service"]
+	if !ok || len(conditions) != 2 {
+		t.Fatalf("expected 2 conditions for my-service, got %+v", conditions)
+	}
+	if got := aws.StringValue(conditions[0].Field); got != "http-header" {
+		t.Errorf("conditions[0].Field = %q, want http-header", got)
+	}
+	if got := aws.StringValue(conditions[0].HttpHeaderConfig.HttpHeaderName); got != "X-Foo" {
+		t.Errorf("conditions[0].HttpHeaderConfig.HttpHeaderName = %q, want X-Foo", got)
+	}
+	if got := aws.StringValue(conditions[1].Field); got != "query-string" {
+		t.Errorf("conditions[1].Field = %q, want query-string", got)
+	}
+}
+
+func TestParseAnnotationsActions(t *testing.T) {
+	raw := map[string]string{
+		actionsPrefix + "redirect-service":       `{"type":"redirect","redirectConfig":{"host":"#{host}","port":"443","protocol":"HTTPS","statusCode":"HTTP_301"}}`,
+		actionsPrefix + "fixed-response-service": `{"type":"fixed-response","fixedResponseConfig":{"contentType":"text/plain","messageBody":"nope","statusCode":"404"}}`,
+	}
+
+	a, err := ParseAnnotations(raw)
+	if err != nil {
+		t.Fatalf("ParseAnnotations: %v", err)
+	}
+
+	redirect, ok := a.Actions["redirect-service"]
+	if !ok || aws.StringValue(redirect.Type) != "redirect" {
+		t.Fatalf("expected a redirect action for redirect-service, got %+v", redirect)
+	}
+	if got := aws.StringValue(redirect.RedirectConfig.StatusCode); got != "HTTP_301" {
+		t.Errorf("redirect.RedirectConfig.StatusCode = %q, want HTTP_301", got)
+	}
+
+	fixed, ok := a.Actions["fixed-response-service"]
+	if !ok || aws.StringValue(fixed.Type) != "fixed-response" {
+		t.Fatalf("expected a fixed-response action for fixed-response-service, got %+v", fixed)
+	}
+	if got := aws.StringValue(fixed.FixedResponseConfig.MessageBody); got != "nope" {
+		t.Errorf("fixed.FixedResponseConfig.MessageBody = %q, want nope", got)
+	}
+}
+
+func TestIsNLB(t *testing.T) {
+	cases := []struct {
+		loadBalancerType string
+		want             bool
+	}{
+		{"nlb", true},
+		{"NLB", true},
+		{" nlb ", true},
+		{"", false},
+		{"alb", false},
+	}
+
+	for _, c := range cases {
+		a := &Annotations{LoadBalancerType: c.loadBalancerType}
+		if got := a.IsNLB(); got != c.want {
+			t.Errorf("IsNLB() with LoadBalancerType %q = %v, want %v", c.loadBalancerType, got, c.want)
+		}
+	}
+}
@@ -0,0 +1,85 @@
+// Package acm wraps the subset of the AWS Certificate Manager API the
+// controller needs to resolve an Ingress TLS host to a certificate ARN for
+// SNI attachment.
+package acm
+
+import (
+	"errors"
+	"strings"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/session"
+	"github.com/aws/aws-sdk-go/service/acm"
+	"github.com/aws/aws-sdk-go/service/acm/acmiface"
+)
+
+// ErrNoMatchingCertificate is returned by CertificateArnForHost when ACM has
+// no issued certificate covering host. Callers that only want a best-effort
+// SNI match (as opposed to a hard failure) should check for this specific
+// error rather than treating every error the same way; anything else (an
+// API throttle, an auth failure, ...) is a real failure and should not be
+// swallowed the same way a simple "no match" is.
+var ErrNoMatchingCertificate = errors.New("acm: no matching certificate")
+
+// ACMsvc is the package-level ACM client, mirroring the elbv2 package's
+// ELBV2svc convention. It's a var rather than a constructor-returned value
+// so the alb/* packages, which are built around package-level AWS clients,
+// can reference it without threading a client through every call.
+var ACMsvc *ACM
+
+// ACM wraps an ACM API client.
+type ACM struct {
+	acmiface.ACMAPI
+}
+
+// NewACM returns an ACM backed by a default AWS session.
+func NewACM(awsSession *session.Session) *ACM {
+	return &ACM{ACMAPI: acm.New(awsSession)}
+}
+
+// CertificateArnForHost returns the ARN of an ISSUED ACM certificate whose
+// domain name covers host; subject alternative names are not checked. It returns
+// ErrNoMatchingCertificate, not a generic error, when ACM simply has nothing
+// that matches, so callers can distinguish that from a real API failure.
+func (a *ACM) CertificateArnForHost(host string) (*string, error) {
+	var match *string
+
+	err := a.ListCertificatesPages(&acm.ListCertificatesInput{
+		CertificateStatuses: []*string{aws.String(acm.CertificateStatusIssued)},
+	}, func(page *acm.ListCertificatesOutput, lastPage bool) bool {
+		for _, summary := range page.CertificateSummaryList {
+			if certCoversHost(summary.DomainName, host) {
+				match = summary.CertificateArn
+				return false
+			}
+		}
+		return true
+	})
+	if err != nil {
+		return nil, err
+	}
+	if match == nil {
+		return nil, ErrNoMatchingCertificate
+	}
+	return match, nil
+}
+
+func certCoversHost(domainName *string, host string) bool {
+	if domainName == nil {
+		return false
+	}
+	if *domainName == host {
+		return true
+	}
+	// A leading "*." wildcard certificate covers any single label in place
+	// of the wildcard, e.g. "*.example.com" covers "foo.example.com" but not
+	// "example.com" or "a.foo.example.com".
+	if len(*domainName) > 2 && (*domainName)[:2] == "*." {
+		suffix := (*domainName)[1:] // ".example.com"
+		if len(host) > len(suffix) && host[len(host)-len(suffix):] == suffix {
+			label := host[:len(host)-len(suffix)]
+			return len(label) > 0 && !strings.Contains(label, ".")
+		}
+	}
+	return false
+}
@@ -0,0 +1,218 @@
+// Package elbv2 wraps the subset of the Elastic Load Balancing v2 API the
+// controller needs.
+package elbv2
+
+import (
+	"sync"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/session"
+	"github.com/aws/aws-sdk-go/service/elbv2"
+	"github.com/aws/aws-sdk-go/service/elbv2/elbv2iface"
+)
+
+// ELBV2svc is the package-level ELBV2 client. Every alb/* package that needs
+// to call the API does so through this var rather than taking a client as a
+// constructor argument.
+var ELBV2svc *ELBV2
+
+// DescribeRulesCache names the cache DescribeRulesCached/CacheDelete operate
+// on, for callers that hold more than one cache keyed by the same kind of
+// key (a listener ARN).
+const DescribeRulesCache = "DescribeRules"
+
+// describeRulesCacheTTL bounds how stale a cached DescribeRules response can
+// be before it's refetched even if nothing explicitly invalidated it.
+const describeRulesCacheTTL = 60 * time.Second
+
+type cacheEntry struct {
+	value   interface{}
+	expires time.Time
+}
+
+// ELBV2 wraps an ELBV2 API client, plus a small set of TTL caches for
+// expensive/frequently-repeated describe calls.
+type ELBV2 struct {
+	elbv2iface.ELBV2API
+
+	mutex sync.Mutex
+	cache map[string]map[string]cacheEntry
+}
+
+// NewELBV2 returns an ELBV2 backed by a default AWS session.
+func NewELBV2(awsSession *session.Session) *ELBV2 {
+	return &ELBV2{
+		ELBV2API: elbv2.New(awsSession),
+		cache:    make(map[string]map[string]cacheEntry),
+	}
+}
+
+// CacheDelete evicts the entry for key from the named cache, if present.
+// Callers use this to invalidate a cached describe response the moment they
+// know it's stale, rather than waiting out the TTL.
+func (e *ELBV2) CacheDelete(cacheName, key string) {
+	e.mutex.Lock()
+	defer e.mutex.Unlock()
+	delete(e.cache[cacheName], key)
+}
+
+func (e *ELBV2) cacheGet(cacheName, key string) (interface{}, bool) {
+	e.mutex.Lock()
+	defer e.mutex.Unlock()
+	entry, ok := e.cache[cacheName][key]
+	if !ok || time.Now().After(entry.expires) {
+		return nil, false
+	}
+	return entry.value, true
+}
+
+func (e *ELBV2) cacheSet(cacheName, key string, value interface{}, ttl time.Duration) {
+	e.mutex.Lock()
+	defer e.mutex.Unlock()
+	if e.cache[cacheName] == nil {
+		e.cache[cacheName] = make(map[string]cacheEntry)
+	}
+	e.cache[cacheName][key] = cacheEntry{value: value, expires: time.Now().Add(ttl)}
+}
+
+// DescribeRulesCached is DescribeRules backed by a TTL cache keyed by
+// ListenerArn, so a listener whose rules haven't changed since the last
+// sync avoids a DescribeRules round-trip entirely. Callers that mutate a
+// rule under a listener must CacheDelete(DescribeRulesCache, listenerArn)
+// afterwards so the next sync re-fetches instead of reconciling against a
+// stale snapshot.
+func (e *ELBV2) DescribeRulesCached(in *elbv2.DescribeRulesInput) (*elbv2.DescribeRulesOutput, error) {
+	key := aws.StringValue(in.ListenerArn)
+	if cached, ok := e.cacheGet(DescribeRulesCache, key); ok {
+		return cached.(*elbv2.DescribeRulesOutput), nil
+	}
+
+	out, err := e.ELBV2API.DescribeRules(in)
+	if err != nil {
+		return nil, err
+	}
+
+	e.cacheSet(DescribeRulesCache, key, out, describeRulesCacheTTL)
+	return out, nil
+}
+
+// DescribeLoadBalancerDNSName returns the DNS name of the load balancer
+// identified by arn, for publishing onto Ingress status.
+func (e *ELBV2) DescribeLoadBalancerDNSName(arn *string) (string, error) {
+	resp, err := e.DescribeLoadBalancers(&elbv2.DescribeLoadBalancersInput{
+		LoadBalancerArns: []*string{arn},
+	})
+	if err != nil {
+		return "", err
+	}
+	if len(resp.LoadBalancers) == 0 {
+		return "", nil
+	}
+	return aws.StringValue(resp.LoadBalancers[0].DNSName), nil
+}
+
+// CreateRule creates a single rule and returns it as ALB stored it.
+func (e *ELBV2) CreateRule(in *elbv2.CreateRuleInput) (*elbv2.Rule, error) {
+	resp, err := e.ELBV2API.CreateRule(in)
+	if err != nil {
+		return nil, err
+	}
+	return resp.Rules[0], nil
+}
+
+// ModifyRule updates a rule's conditions and/or actions and returns it as
+// ALB stored it.
+func (e *ELBV2) ModifyRule(in *elbv2.ModifyRuleInput) (*elbv2.Rule, error) {
+	resp, err := e.ELBV2API.ModifyRule(in)
+	if err != nil {
+		return nil, err
+	}
+	return resp.Rules[0], nil
+}
+
+// DeleteRule deletes the rule identified by arn.
+func (e *ELBV2) DeleteRule(arn *string) error {
+	_, err := e.ELBV2API.DeleteRule(&elbv2.DeleteRuleInput{RuleArn: arn})
+	return err
+}
+
+// CreateListener creates a single listener and returns it as ALB stored it.
+func (e *ELBV2) CreateListener(in *elbv2.CreateListenerInput) (*elbv2.Listener, error) {
+	resp, err := e.ELBV2API.CreateListener(in)
+	if err != nil {
+		return nil, err
+	}
+	return resp.Listeners[0], nil
+}
+
+// ModifyListener updates a listener's port, protocol and/or default
+// certificate and returns it as ALB stored it.
+func (e *ELBV2) ModifyListener(in *elbv2.ModifyListenerInput) (*elbv2.Listener, error) {
+	resp, err := e.ELBV2API.ModifyListener(in)
+	if err != nil {
+		return nil, err
+	}
+	return resp.Listeners[0], nil
+}
+
+// DeleteListener deletes the listener identified by arn.
+func (e *ELBV2) DeleteListener(arn *string) error {
+	_, err := e.ELBV2API.DeleteListener(&elbv2.DeleteListenerInput{ListenerArn: arn})
+	return err
+}
+
+// AddListenerCertificates attaches arns to listenerArn as SNI certificates.
+func (e *ELBV2) AddListenerCertificates(listenerArn *string, arns []*string) error {
+	if len(arns) == 0 {
+		return nil
+	}
+	_, err := e.ELBV2API.AddListenerCertificates(&elbv2.AddListenerCertificatesInput{
+		ListenerArn:  listenerArn,
+		Certificates: certificatesFor(arns),
+	})
+	return err
+}
+
+// RemoveListenerCertificates detaches arns from listenerArn's SNI
+// certificates.
+func (e *ELBV2) RemoveListenerCertificates(listenerArn *string, arns []*string) error {
+	if len(arns) == 0 {
+		return nil
+	}
+	_, err := e.ELBV2API.RemoveListenerCertificates(&elbv2.RemoveListenerCertificatesInput{
+		ListenerArn:  listenerArn,
+		Certificates: certificatesFor(arns),
+	})
+	return err
+}
+
+// DescribeListenerCertificatesForListener returns the ARNs of every SNI
+// certificate currently attached to listenerArn. The listener's default
+// certificate is excluded, since it's tracked separately as part of the
+// listener itself.
+func (e *ELBV2) DescribeListenerCertificatesForListener(listenerArn *string) ([]*string, error) {
+	resp, err := e.ELBV2API.DescribeListenerCertificates(&elbv2.DescribeListenerCertificatesInput{
+		ListenerArn: listenerArn,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	var arns []*string
+	for _, cert := range resp.Certificates {
+		if aws.BoolValue(cert.IsDefault) {
+			continue
+		}
+		arns = append(arns, cert.CertificateArn)
+	}
+	return arns, nil
+}
+
+func certificatesFor(arns []*string) []*elbv2.Certificate {
+	certs := make([]*elbv2.Certificate, 0, len(arns))
+	for _, arn := range arns {
+		certs = append(certs, &elbv2.Certificate{CertificateArn: arn})
+	}
+	return certs
+}
@@ -0,0 +1,48 @@
+// Package log provides the leveled, per-Ingress-prefixed logger passed
+// around the alb.ingress.kubernetes.io reconciliation packages.
+package log
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"os"
+)
+
+// Logger is a minimal leveled logger. Every call is prefixed with the
+// logger's Prefix (typically "namespace/name") so log lines from concurrent
+// Ingress reconciles can be told apart.
+type Logger struct {
+	Prefix string
+	debug  bool
+	out    *log.Logger
+}
+
+// New returns a Logger that prefixes every line with prefix. debug controls
+// whether Debugf calls are emitted.
+func New(prefix string, debug bool) *Logger {
+	return &Logger{Prefix: prefix, debug: debug, out: log.New(os.Stderr, "", log.LstdFlags)}
+}
+
+func (l *Logger) printf(level, format string, args ...interface{}) {
+	l.out.Printf("%s: [%s] %s", level, l.Prefix, fmt.Sprintf(format, args...))
+}
+
+func (l *Logger) Infof(format string, args ...interface{})  { l.printf("INFO", format, args...) }
+func (l *Logger) Errorf(format string, args ...interface{}) { l.printf("ERROR", format, args...) }
+
+func (l *Logger) Debugf(format string, args ...interface{}) {
+	if l.debug {
+		l.printf("DEBUG", format, args...)
+	}
+}
+
+// Prettify renders v as indented JSON for debug logging, falling back to
+// fmt.Sprintf if it isn't marshalable.
+func Prettify(v interface{}) string {
+	b, err := json.MarshalIndent(v, "", "  ")
+	if err != nil {
+		return fmt.Sprintf("%+v", v)
+	}
+	return string(b)
+}